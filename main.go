@@ -1,22 +1,84 @@
 package main
 
 import (
+	"context"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
 	"flag"
 	"fmt"
 	"io/ioutil"
-	"log"
 	"net/http"
-	"os"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/BurntSushi/toml"
+	"github.com/fsnotify/fsnotify"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/sirupsen/logrus"
 )
 
+// logger is the exporter's shared structured logger, configured in main()
+// from the --log.level and --log.format flags.
+var logger = logrus.New()
+
+// requestCounter generates the correlation IDs attached to every outbound
+// HTTP call's log fields, so a scrape's requests can be tied together.
+var requestCounter int64
+
 // https://stackoverflow.com/a/16491396
 type Config struct {
 	APIKey string
+	// Filter detailed per-host/per-service metrics down to these groups. An
+	// empty list means "no filter", i.e. every group is allowed through.
+	HostGroupFilter    []string
+	ServiceGroupFilter []string
+
+	// ScrapeTimeoutSeconds and HTTPRetries reload onto the running exporter
+	// just like APIKey/*GroupFilter above. 0 means "not set in this config
+	// file", leaving the exporter's current value (seeded from
+	// --collector.scrape-timeout/--nagios.http-retries) untouched, rather
+	// than resetting it to zero.
+	//
+	// TLS settings (--nagios.tls.*) are deliberately not here: rebuilding
+	// the shared http.Client's Transport on every reload risks silently
+	// dropping a CLI-configured client certificate or CA bundle the moment
+	// a config file omits them, so those still require a process restart.
+	ScrapeTimeoutSeconds int
+	HTTPRetries          int
+
+	// Modules holds the per-target overrides used by the /probe endpoint,
+	// keyed by module name. A probe with no module (or module=default) and
+	// no "default" entry uses the top-level APIKey and group filters above;
+	// a probe naming any other missing module is rejected. A module's empty
+	// APIKey or unset group filters also fall back to the top-level values.
+	// ScrapeTimeoutSeconds and HTTPRetries above do not apply to /probe.
+	Modules map[string]ModuleConfig
+}
+
+// ModuleConfig is a named set of /probe overrides, letting one exporter
+// process monitor NagiosXI instances with different credentials, TLS
+// settings, or timeouts.
+type ModuleConfig struct {
+	APIKey             string
+	HostGroupFilter    []string
+	ServiceGroupFilter []string
+
+	TLSCAFile             string
+	TLSCertFile           string
+	TLSKeyFile            string
+	TLSInsecureSkipVerify bool
+
+	// HTTPTimeoutSeconds bounds each request to the probed target; 0 falls
+	// back to defaultScrapeTimeout.
+	HTTPTimeoutSeconds int
+	HTTPRetries        int
 }
 
 const namespace = "nagios"
@@ -26,6 +88,23 @@ const hoststatusAPI = "/objects/hoststatus"
 const servicestatusAPI = "/objects/servicestatus"
 const systeminfoAPI = "/system/info"
 const systemstatusAPI = "/system/status"
+const alertlogAPI = "/objects/alertlog"
+const hostgroupAPI = "/objects/hostgroup"
+const servicegroupAPI = "/objects/servicegroup"
+
+// defaultDetailedCardinalityLimit caps the number of per-host/per-service
+// time series the detailed collectors will emit in a single scrape. Without
+// a cap, a large NagiosXI instance with tens of thousands of services could
+// blow up Prometheus's series cardinality.
+const defaultDetailedCardinalityLimit = 5000
+
+// defaultScrapeTimeout bounds how long the systeminfo/hoststatus/servicestatus/
+// alerts sub-collectors are allowed to run before the scrape is abandoned.
+const defaultScrapeTimeout = 10 * time.Second
+
+// defaultAlertWindow bounds the alertlog query on an exporter's first scrape,
+// before collectAlerts has a previous scrape time to start from.
+const defaultAlertWindow = 5 * time.Minute
 
 type systemStatus struct {
 	// https://stackoverflow.com/questions/21151765/cannot-unmarshal-string-into-go-value-of-type-int64
@@ -37,40 +116,146 @@ type systemInfo struct {
 }
 
 // generated with https://github.com/bashtian/jsonutils
+//
+// Note: the hoststatus API does not return hostgroup membership, so group
+// filtering is resolved separately via hostgroupAPI; see hostgroupList and
+// fetchHostGroupMembers.
 type hostStatus struct {
 	Recordcount int64 `json:"recordcount"`
 	Hoststatus  []struct {
+		HostName               string  `json:"host_name"`
 		HostObjectID           float64 `json:"host_object_id,string"`
 		CheckType              float64 `json:"check_type,string"`
 		CurrentState           float64 `json:"current_state,string"`
 		IsFlapping             float64 `json:"is_flapping,string"`
 		ScheduledDowntimeDepth float64 `json:"scheduled_downtime_depth,string"`
+		LastCheck              float64 `json:"last_check,string"`
+		Latency                float64 `json:"latency,string"`
 	} `json:"hoststatus"`
 }
 
+// serviceStatus: the servicestatus API does not return servicegroup
+// membership either, so service group filtering is resolved separately via
+// servicegroupAPI; see servicegroupList and fetchServiceGroupMembers.
 type serviceStatus struct {
 	Recordcount   int64 `json:"recordcount"`
 	Servicestatus []struct {
+		HostName               string  `json:"host_name"`
+		ServiceDescription     string  `json:"service_description"`
 		HasBeenChecked         float64 `json:"has_been_checked,string"`
 		ShouldBeScheduled      float64 `json:"should_be_scheduled,string"`
 		CheckType              float64 `json:"check_type,string"`
 		CurrentState           float64 `json:"current_state,string"`
 		IsFlapping             float64 `json:"is_flapping,string"`
 		ScheduledDowntimeDepth float64 `json:"scheduled_downtime_depth,string"`
+		LastCheck              float64 `json:"last_check,string"`
+		Latency                float64 `json:"latency,string"`
 	} `json:"servicestatus"`
 }
 
-func ReadConfig(configPath string) Config {
+// hostgroupList is the hostgroupAPI response. Members is a comma-separated
+// list of host names, matching Nagios's config-file hostgroup member format.
+type hostgroupList struct {
+	Recordcount int64 `json:"recordcount"`
+	Hostgroup   []struct {
+		HostgroupName string `json:"hostgroup_name"`
+		Members       string `json:"members"`
+	} `json:"hostgroup"`
+}
+
+// servicegroupList is the servicegroupAPI response. Members is a
+// comma-separated list of alternating host/service-description pairs,
+// matching Nagios's config-file servicegroup member format.
+type servicegroupList struct {
+	Recordcount  int64 `json:"recordcount"`
+	Servicegroup []struct {
+		ServicegroupName string `json:"servicegroup_name"`
+		Members          string `json:"members"`
+	} `json:"servicegroup"`
+}
 
+type alertLog struct {
+	Recordcount int64 `json:"recordcount"`
+	Alertlog    []struct {
+		HostName           string  `json:"host_name"`
+		ServiceDescription string  `json:"service_description"`
+		State              float64 `json:"state,string"`
+	} `json:"alertlog"`
+}
+
+// loadConfig reads and decodes the TOML config at configPath without
+// terminating the process, so it can be reused by the config watcher and
+// the /-/reload endpoint.
+func loadConfig(configPath string) (Config, error) {
 	var conf Config
 	if _, err := toml.DecodeFile(configPath, &conf); err != nil {
-		fmt.Fprintf(os.Stderr, "error: %v\n", err)
-		os.Exit(2)
+		return Config{}, err
+	}
+
+	return conf, nil
+}
+
+func ReadConfig(configPath string) Config {
+
+	conf, err := loadConfig(configPath)
+	if err != nil {
+		logger.WithError(err).Fatal("failed to read config")
 	}
 
 	return conf
 }
 
+// configHolder is the reloadable Config backing the /probe endpoint's module
+// lookups. It's separate from the Exporter's own mutex-guarded fields
+// because /probe builds a fresh Exporter per request rather than reading
+// off the main one.
+type configHolder struct {
+	mu   sync.RWMutex
+	conf Config
+	// tlsConfigs caches the *tls.Config built for each module, keyed by
+	// module name, so /probe doesn't re-read and re-parse CA/client
+	// certificates from disk on every scrape. Cleared on every reload.
+	tlsConfigs map[string]*tls.Config
+}
+
+func (c *configHolder) get() Config {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.conf
+}
+
+func (c *configHolder) set(conf Config) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.conf = conf
+	c.tlsConfigs = nil
+}
+
+// moduleTLSConfig returns the cached tls.Config for moduleName, building
+// and caching it via buildTLSConfig on first use.
+func (c *configHolder) moduleTLSConfig(moduleName string, module ModuleConfig) (*tls.Config, error) {
+	c.mu.RLock()
+	cached, ok := c.tlsConfigs[moduleName]
+	c.mu.RUnlock()
+	if ok {
+		return cached, nil
+	}
+
+	tlsConfig, err := buildTLSConfig(module.TLSCAFile, module.TLSCertFile, module.TLSKeyFile, module.TLSInsecureSkipVerify)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	if c.tlsConfigs == nil {
+		c.tlsConfigs = make(map[string]*tls.Config)
+	}
+	c.tlsConfigs[moduleName] = tlsConfig
+	c.mu.Unlock()
+
+	return tlsConfig, nil
+}
+
 var (
 	// Metrics
 	// TODO - writing in this style seems more readable https://github.com/prometheus/haproxy_exporter/blob/main/haproxy_exporter.go#L138
@@ -192,16 +377,247 @@ var (
 		"Nagios version information",
 		[]string{"version"}, nil,
 	)
+
+	// Alerts
+	alertsTotal = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "alerts_total"),
+		"Total number of alert log entries returned since the last successful scrape",
+		nil, nil,
+	)
+
+	alertsFiring = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "alerts_firing"),
+		"Number of alerts that fired since the last successful scrape, by severity/host/service",
+		[]string{"severity", "host", "service"}, nil,
+	)
+
+	// Per-object metrics, only emitted when --collector.hosts.detailed
+	// and/or --collector.services.detailed are set.
+	hostState = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "host_state"),
+		"Current state of the host (0=up, 1=down, 2=unreachable)",
+		[]string{"host"}, nil,
+	)
+
+	hostLastCheckSeconds = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "host_last_check_seconds"),
+		"Timestamp of the last check of the host",
+		[]string{"host"}, nil,
+	)
+
+	hostLatencySeconds = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "host_latency_seconds"),
+		"Latency of the last check of the host",
+		[]string{"host"}, nil,
+	)
+
+	serviceState = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "service_state"),
+		"Current state of the service (0=ok, 1=warning, 2=critical, 3=unknown)",
+		[]string{"host", "service"}, nil,
+	)
+
+	serviceLastCheckSeconds = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "service_last_check_seconds"),
+		"Timestamp of the last check of the service",
+		[]string{"host", "service"}, nil,
+	)
+
+	serviceLatencySeconds = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "service_latency_seconds"),
+		"Latency of the last check of the service",
+		[]string{"host", "service"}, nil,
+	)
+
+	// detailedSeriesDropped counts per-object series that were dropped due
+	// to the cardinality cap, so operators can tell the cap is actively
+	// trimming output rather than a filter silently matching nothing.
+	detailedSeriesDropped = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "detailed_series_dropped_total"),
+		"Number of per-host/per-service series dropped due to the cardinality limit",
+		[]string{"collector"}, nil,
+	)
+
+	// Scrape instrumentation
+	scrapeCollectorDurationSeconds = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "scrape_collector", "duration_seconds"),
+		"Duration of a sub-collector scrape",
+		[]string{"collector"}, nil,
+	)
+
+	scrapeCollectorSuccess = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "scrape_collector", "success"),
+		"Whether a sub-collector scrape succeeded",
+		[]string{"collector"}, nil,
+	)
+
+	// configReloadsTotal is registered directly (it isn't tied to a scrape,
+	// since reloads happen on fsnotify events or /-/reload requests).
+	configReloadsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "exporter",
+			Name:      "config_reloads_total",
+			Help:      "Number of config reload attempts, by result",
+		},
+		[]string{"result"},
+	)
 )
 
 type Exporter struct {
-	nagiosEndpoint, nagiosAPIKey string
+	nagiosEndpoint string
+
+	// mu guards the fields below, which can be swapped out at runtime by
+	// a config reload (fsnotify watch or /-/reload request).
+	mu           sync.RWMutex
+	nagiosAPIKey string
+	// hostGroupFilter/serviceGroupFilter restrict detailed metrics to the
+	// named groups. A nil/empty map means no filtering.
+	hostGroupFilter, serviceGroupFilter map[string]bool
+
+	// scrapeTimeout bounds the context shared by the sub-collectors in
+	// HitNagiosRestApisAndUpdateMetrics. Reloadable via Config.ScrapeTimeoutSeconds.
+	scrapeTimeout time.Duration
+	// httpRetries is the number of additional attempts made for a request
+	// that fails with a transient network error or 5xx response. Reloadable
+	// via Config.HTTPRetries.
+	httpRetries int
+
+	// detailed enables the opt-in per-host/per-service labeled metrics.
+	hostsDetailed, servicesDetailed bool
+	// detailedCardinalityLimit is the hard cap on per-host/per-service
+	// series emitted in a single scrape.
+	detailedCardinalityLimit int
+
+	// httpClient is the single client reused for every request to the
+	// Nagios instance, carrying TLS config and per-request timeout. Not
+	// reloadable; see the Config.ScrapeTimeoutSeconds doc comment.
+	httpClient *http.Client
+
+	// lastAlertsScrapeUnix is the unix time of the last successful alertlog
+	// fetch, so collectAlerts only asks Nagios for entries since then
+	// instead of replaying the entire alert history every scrape. Accessed
+	// with atomic ops rather than mu, since it's only ever touched by the
+	// alerts collector.
+	lastAlertsScrapeUnix int64
 }
 
 func NewExporter(nagiosEndpoint, nagiosAPIKey string) *Exporter {
 	return &Exporter{
-		nagiosEndpoint: nagiosEndpoint,
-		nagiosAPIKey:   nagiosAPIKey,
+		nagiosEndpoint:           nagiosEndpoint,
+		nagiosAPIKey:             nagiosAPIKey,
+		detailedCardinalityLimit: defaultDetailedCardinalityLimit,
+		scrapeTimeout:            defaultScrapeTimeout,
+		httpClient:               http.DefaultClient,
+	}
+}
+
+// buildTLSConfig assembles a tls.Config from the --nagios.tls.* flags. An
+// empty caFile/certFile/keyFile simply leaves those settings at their Go
+// defaults.
+func buildTLSConfig(caFile, certFile, keyFile string, insecureSkipVerify bool) (*tls.Config, error) {
+	tlsConfig := &tls.Config{InsecureSkipVerify: insecureSkipVerify}
+
+	if caFile != "" {
+		caCert, err := ioutil.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading CA bundle: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caCert) {
+			return nil, fmt.Errorf("failed to parse CA bundle %q", caFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if certFile != "" && keyFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("loading client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
+}
+
+// basicAuthMiddleware wraps next with HTTP basic auth, used to protect the
+// exporter's own /metrics endpoint.
+func basicAuthMiddleware(next http.Handler, username, password string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, pass, ok := r.BasicAuth()
+		if !ok || subtle.ConstantTimeCompare([]byte(user), []byte(username)) != 1 || subtle.ConstantTimeCompare([]byte(pass), []byte(password)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Basic realm="nagios_exporter"`)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// newGroupFilter turns a TOML string list into a lookup set. An empty list
+// means "allow everything", so it intentionally returns a nil map.
+func newGroupFilter(groups []string) map[string]bool {
+	if len(groups) == 0 {
+		return nil
+	}
+
+	filter := make(map[string]bool, len(groups))
+	for _, g := range groups {
+		filter[g] = true
+	}
+
+	return filter
+}
+
+// apiKey returns the exporter's current Nagios API key, taking reloads into
+// account.
+func (e *Exporter) apiKey() string {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.nagiosAPIKey
+}
+
+// groupFilters returns the exporter's current hostgroup/servicegroup
+// filters, taking reloads into account.
+func (e *Exporter) groupFilters() (hostGroupFilter, serviceGroupFilter map[string]bool) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.hostGroupFilter, e.serviceGroupFilter
+}
+
+// scrapeTimeoutValue returns the exporter's current scrape timeout, taking
+// reloads into account.
+func (e *Exporter) scrapeTimeoutValue() time.Duration {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.scrapeTimeout
+}
+
+// httpRetriesValue returns the exporter's current retry count, taking
+// reloads into account.
+func (e *Exporter) httpRetriesValue() int {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.httpRetries
+}
+
+// updateConfig atomically swaps in the API key, group filters, scrape
+// timeout, and retry count from a freshly loaded Config, used by the
+// fsnotify watcher and /-/reload handler. A zero ScrapeTimeoutSeconds/
+// HTTPRetries means the config file didn't set that field, so the
+// exporter's current value (seeded from CLI flags) is left alone.
+func (e *Exporter) updateConfig(conf Config) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.nagiosAPIKey = conf.APIKey
+	e.hostGroupFilter = newGroupFilter(conf.HostGroupFilter)
+	e.serviceGroupFilter = newGroupFilter(conf.ServiceGroupFilter)
+	if conf.ScrapeTimeoutSeconds > 0 {
+		e.scrapeTimeout = time.Duration(conf.ScrapeTimeoutSeconds) * time.Second
+	}
+	if conf.HTTPRetries > 0 {
+		e.httpRetries = conf.HTTPRetries
 	}
 }
 
@@ -228,41 +644,67 @@ func (e *Exporter) Describe(ch chan<- *prometheus.Desc) {
 	ch <- servicesDowntime
 	// System
 	ch <- versionInfo
+	// Alerts
+	ch <- alertsTotal
+	ch <- alertsFiring
+
+	if e.hostsDetailed {
+		ch <- hostState
+		ch <- hostLastCheckSeconds
+		ch <- hostLatencySeconds
+	}
+	if e.servicesDetailed {
+		ch <- serviceState
+		ch <- serviceLastCheckSeconds
+		ch <- serviceLatencySeconds
+	}
+	ch <- detailedSeriesDropped
+
+	ch <- scrapeCollectorDurationSeconds
+	ch <- scrapeCollectorSuccess
 }
 
 func (e *Exporter) TestNagiosConnectivity() (float64, error) {
+	correlationID := nextCorrelationID("systemstatus")
+	start := time.Now()
+	fields := logrus.Fields{"collector": "systemstatus", "endpoint": systemstatusAPI, "correlation_id": correlationID}
 
-	req, err := http.NewRequest("GET", e.nagiosEndpoint+systemstatusAPI+"?apikey="+e.nagiosAPIKey, nil)
+	ctx, cancel := context.WithTimeout(context.Background(), e.scrapeTimeoutValue())
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", e.nagiosEndpoint+systemstatusAPI+"?apikey="+e.apiKey(), nil)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "error: %v\n", err)
-		os.Exit(1)
+		logger.WithFields(fields).WithError(err).Error("failed to build request")
+		return 0, err
 	}
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("User-Agent", "Prometheus")
 
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := e.doRequest(ctx, req)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "error: %v\n", err)
-		os.Exit(1)
-	}
-	if resp.Body != nil {
-		defer resp.Body.Close()
+		logger.WithFields(fields).WithField("latency", time.Since(start).Seconds()).WithError(err).Error("request failed")
+		return 0, err
 	}
+	defer resp.Body.Close()
 
 	body, readErr := ioutil.ReadAll(resp.Body)
 	if readErr != nil {
-		log.Fatal(readErr)
+		logger.WithFields(fields).WithError(readErr).Error("failed to read response body")
+		return 0, readErr
 	}
-	// TODO - better logging and error handling here
+
 	systemStatusObject := systemStatus{}
-	jsonErr := json.Unmarshal(body, &systemStatusObject)
-	if jsonErr != nil {
-		log.Fatal(jsonErr)
+	if jsonErr := json.Unmarshal(body, &systemStatusObject); jsonErr != nil {
+		logger.WithFields(fields).WithError(jsonErr).Error("failed to unmarshal response")
+		return 0, jsonErr
 	}
 
-	fmt.Println(systemStatusObject.Running)
-	// TODO - figure out which err to return and handle scrape failure better
-	return systemStatusObject.Running, err
+	logger.WithFields(fields).WithFields(logrus.Fields{
+		"status":  resp.StatusCode,
+		"latency": time.Since(start).Seconds(),
+	}).Debug("request completed")
+
+	return systemStatusObject.Running, nil
 }
 
 func (e *Exporter) Collect(ch chan<- prometheus.Metric) {
@@ -272,7 +714,7 @@ func (e *Exporter) Collect(ch chan<- prometheus.Metric) {
 		ch <- prometheus.MustNewConstMetric(
 			up, prometheus.GaugeValue, nagiosStatus,
 		)
-		log.Println(err)
+		logger.WithError(err).Error("nagios connectivity check failed")
 		return
 	}
 	ch <- prometheus.MustNewConstMetric(
@@ -283,38 +725,149 @@ func (e *Exporter) Collect(ch chan<- prometheus.Metric) {
 
 }
 
-func (e *Exporter) HitNagiosRestApisAndUpdateMetrics(ch chan<- prometheus.Metric) {
-
-	// get system version info
-	req, err := http.NewRequest("GET", e.nagiosEndpoint+systeminfoAPI+"?apikey="+e.nagiosAPIKey, nil)
+// nextCorrelationID returns a per-collector identifier used to tie a
+// request's log lines together across a scrape.
+func nextCorrelationID(collector string) string {
+	return fmt.Sprintf("%s-%d", collector, atomic.AddInt64(&requestCounter, 1))
+}
 
-	// TODO - better error handling on here, maybe function-ize the calls?
-	// especially the HTTP gets - make a single HTTP GET function that returns a `body` object
+// fetchJSON issues a single GET request against the given NagiosXI API path,
+// honoring ctx for cancellation/timeout, and returns the raw response body.
+// It logs the endpoint, status, latency, and correlation ID for every call.
+func (e *Exporter) fetchJSON(ctx context.Context, apiPath, collector string) ([]byte, error) {
+	correlationID := nextCorrelationID(collector)
+	start := time.Now()
+	fields := logrus.Fields{"collector": collector, "endpoint": apiPath, "correlation_id": correlationID}
+
+	sep := "?"
+	if strings.Contains(apiPath, "?") {
+		sep = "&"
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", e.nagiosEndpoint+apiPath+sep+"apikey="+e.apiKey(), nil)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "error: %v\n", err)
-		os.Exit(1)
+		logger.WithFields(fields).WithError(err).Error("failed to build request")
+		return nil, err
 	}
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("User-Agent", "Prometheus")
 
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := e.doRequest(ctx, req)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "error: %v\n", err)
-		os.Exit(1)
+		logger.WithFields(fields).WithField("latency", time.Since(start).Seconds()).WithError(err).Error("request failed")
+		return nil, err
 	}
-	if resp.Body != nil {
-		defer resp.Body.Close()
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		logger.WithFields(fields).WithError(err).Error("failed to read response body")
+		return nil, err
 	}
 
-	body, readErr := ioutil.ReadAll(resp.Body)
-	if readErr != nil {
-		log.Fatal(readErr)
+	logger.WithFields(fields).WithFields(logrus.Fields{
+		"status":  resp.StatusCode,
+		"latency": time.Since(start).Seconds(),
+	}).Debug("request completed")
+
+	return body, nil
+}
+
+// doRequest performs req using e.httpClient, retrying up to e.httpRetries
+// times with exponential backoff on network errors or 5xx responses. The
+// retry loop honors ctx, so a scrape timeout still bounds the total time
+// spent here.
+func (e *Exporter) doRequest(ctx context.Context, req *http.Request) (*http.Response, error) {
+	client := e.httpClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	retries := e.httpRetriesValue()
+	var lastErr error
+	for attempt := 0; attempt <= retries; attempt++ {
+		if attempt > 0 {
+			backoff := time.Duration(1<<uint(attempt-1)) * time.Second
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-time.After(backoff):
+			}
+		}
+
+		resp, err := client.Do(req)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if resp.StatusCode >= http.StatusInternalServerError {
+			resp.Body.Close()
+			lastErr = fmt.Errorf("server error: %s", resp.Status)
+			continue
+		}
+
+		return resp, nil
 	}
-	// TODO - better logging and error handling here
+
+	return nil, lastErr
+}
+
+// reportCollectorResult records the duration/success metrics shared by every
+// sub-collector in HitNagiosRestApisAndUpdateMetrics.
+func reportCollectorResult(ch chan<- prometheus.Metric, collector string, start time.Time, success bool) {
+	ch <- prometheus.MustNewConstMetric(
+		scrapeCollectorDurationSeconds, prometheus.GaugeValue, time.Since(start).Seconds(), collector,
+	)
+	successValue := 0.0
+	if success {
+		successValue = 1.0
+	}
+	ch <- prometheus.MustNewConstMetric(
+		scrapeCollectorSuccess, prometheus.GaugeValue, successValue, collector,
+	)
+}
+
+// HitNagiosRestApisAndUpdateMetrics hits the systeminfo, hoststatus,
+// servicestatus, and alertlog NagiosXI endpoints concurrently, bounded by
+// e.scrapeTimeout. A failure in one sub-collector is reported via
+// nagios_scrape_collector_success and does not prevent the others from
+// completing.
+func (e *Exporter) HitNagiosRestApisAndUpdateMetrics(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), e.scrapeTimeoutValue())
+	defer cancel()
+
+	var wg sync.WaitGroup
+	wg.Add(4)
+
+	go e.collectSystemInfo(ctx, ch, &wg)
+	go e.collectHostStatus(ctx, ch, &wg)
+	go e.collectServiceStatus(ctx, ch, &wg)
+	go e.collectAlerts(ctx, ch, &wg)
+
+	wg.Wait()
+
+	logger.Debug("endpoint scraped")
+}
+
+// collectSystemInfo hits the systeminfo endpoint and emits version info.
+func (e *Exporter) collectSystemInfo(ctx context.Context, ch chan<- prometheus.Metric, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	start := time.Now()
+	success := true
+	defer func() { reportCollectorResult(ch, "systeminfo", start, success) }()
+
+	body, err := e.fetchJSON(ctx, systeminfoAPI, "systeminfo")
+	if err != nil {
+		logger.WithField("collector", "systeminfo").WithError(err).Error("fetch failed")
+		success = false
+		return
+	}
+
 	systemInfoObject := systemInfo{}
-	jsonErr := json.Unmarshal(body, &systemInfoObject)
-	if jsonErr != nil {
-		log.Fatal(jsonErr)
+	if jsonErr := json.Unmarshal(body, &systemInfoObject); jsonErr != nil {
+		logger.WithField("collector", "systeminfo").WithError(jsonErr).Error("failed to unmarshal response")
+		success = false
+		return
 	}
 
 	// 2022/08/30 20:55:59 json: cannot unmarshal number 5.8.10 into Go struct field systemInfo.version of type float64
@@ -323,34 +876,90 @@ func (e *Exporter) HitNagiosRestApisAndUpdateMetrics(ch chan<- prometheus.Metric
 	ch <- prometheus.MustNewConstMetric(
 		versionInfo, prometheus.GaugeValue, 1, systemInfoObject.Version,
 	)
+}
 
-	// get host status metrics
-	req, err = http.NewRequest("GET", e.nagiosEndpoint+hoststatusAPI+"?apikey="+e.nagiosAPIKey, nil)
+// fetchHostGroupMembers resolves hostGroupFilter (a set of allowed hostgroup
+// names) to the set of host names that belong to any of them, by querying
+// hostgroupAPI. hoststatus objects don't carry their own hostgroup name, so
+// this is the only way to filter detailed host metrics by group.
+func (e *Exporter) fetchHostGroupMembers(ctx context.Context, hostGroupFilter map[string]bool) (map[string]bool, error) {
+	body, err := e.fetchJSON(ctx, hostgroupAPI, "hostgroup")
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "error: %v\n", err)
-		os.Exit(1)
+		return nil, err
 	}
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("User-Agent", "Prometheus")
-	resp, err = http.DefaultClient.Do(req)
+
+	var list hostgroupList
+	if err := json.Unmarshal(body, &list); err != nil {
+		return nil, err
+	}
+
+	members := make(map[string]bool)
+	for _, g := range list.Hostgroup {
+		if !hostGroupFilter[g.HostgroupName] {
+			continue
+		}
+		for _, host := range strings.Split(g.Members, ",") {
+			if host = strings.TrimSpace(host); host != "" {
+				members[host] = true
+			}
+		}
+	}
+
+	return members, nil
+}
+
+// fetchServiceGroupMembers resolves serviceGroupFilter (a set of allowed
+// servicegroup names) to the set of "host/service description" pairs that
+// belong to any of them, by querying servicegroupAPI. servicestatus objects
+// don't carry their own servicegroup name, so this is the only way to
+// filter detailed service metrics by group.
+func (e *Exporter) fetchServiceGroupMembers(ctx context.Context, serviceGroupFilter map[string]bool) (map[string]bool, error) {
+	body, err := e.fetchJSON(ctx, servicegroupAPI, "servicegroup")
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "error: %v\n", err)
-		os.Exit(1)
+		return nil, err
 	}
-	if resp.Body != nil {
-		defer resp.Body.Close()
+
+	var list servicegroupList
+	if err := json.Unmarshal(body, &list); err != nil {
+		return nil, err
 	}
 
-	body, readErr = ioutil.ReadAll(resp.Body)
-	if readErr != nil {
-		log.Fatal(readErr)
+	members := make(map[string]bool)
+	for _, g := range list.Servicegroup {
+		if !serviceGroupFilter[g.ServicegroupName] {
+			continue
+		}
+		pairs := strings.Split(g.Members, ",")
+		for i := 0; i+1 < len(pairs); i += 2 {
+			host := strings.TrimSpace(pairs[i])
+			service := strings.TrimSpace(pairs[i+1])
+			members[host+"/"+service] = true
+		}
 	}
 
-	hostStatusObject := hostStatus{}
+	return members, nil
+}
 
-	jsonErr = json.Unmarshal(body, &hostStatusObject)
-	if jsonErr != nil {
-		log.Fatal(jsonErr)
+// collectHostStatus hits the hoststatus endpoint and emits host metrics.
+func (e *Exporter) collectHostStatus(ctx context.Context, ch chan<- prometheus.Metric, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	start := time.Now()
+	success := true
+	defer func() { reportCollectorResult(ch, "hoststatus", start, success) }()
+
+	body, err := e.fetchJSON(ctx, hoststatusAPI, "hoststatus")
+	if err != nil {
+		logger.WithField("collector", "hoststatus").WithError(err).Error("fetch failed")
+		success = false
+		return
+	}
+
+	hostStatusObject := hostStatus{}
+	if jsonErr := json.Unmarshal(body, &hostStatusObject); jsonErr != nil {
+		logger.WithField("collector", "hoststatus").WithError(jsonErr).Error("failed to unmarshal response")
+		success = false
+		return
 	}
 
 	ch <- prometheus.MustNewConstMetric(
@@ -358,6 +967,18 @@ func (e *Exporter) HitNagiosRestApisAndUpdateMetrics(ch chan<- prometheus.Metric
 	)
 
 	var hostsCount, hostsActiveCheckCount, hostsPassiveCheckCount, hostsUpCount, hostsDownCount, hostsUnreachableCount, hostsFlapCount, hostsDowntimeCount int
+	var hostDetailedSeriesEmitted, hostDetailedSeriesDropped int
+	hostGroupFilter, _ := e.groupFilters()
+
+	var hostGroupMembers map[string]bool
+	if e.hostsDetailed && hostGroupFilter != nil {
+		var groupErr error
+		hostGroupMembers, groupErr = e.fetchHostGroupMembers(ctx, hostGroupFilter)
+		if groupErr != nil {
+			logger.WithField("collector", "hoststatus").WithError(groupErr).Error("failed to resolve host group membership; dropping detailed metrics for this scrape")
+			hostGroupMembers = map[string]bool{}
+		}
+	}
 
 	// iterate through nested json
 	for _, v := range hostStatusObject.Hoststatus {
@@ -365,6 +986,24 @@ func (e *Exporter) HitNagiosRestApisAndUpdateMetrics(ch chan<- prometheus.Metric
 		// for every hosts
 		hostsCount++
 
+		if e.hostsDetailed && (hostGroupFilter == nil || hostGroupMembers[v.HostName]) {
+			// each host contributes three series (state, last check, latency)
+			if hostDetailedSeriesEmitted+3 > e.detailedCardinalityLimit {
+				hostDetailedSeriesDropped += 3
+			} else {
+				hostDetailedSeriesEmitted += 3
+				ch <- prometheus.MustNewConstMetric(
+					hostState, prometheus.GaugeValue, v.CurrentState, v.HostName,
+				)
+				ch <- prometheus.MustNewConstMetric(
+					hostLastCheckSeconds, prometheus.GaugeValue, v.LastCheck, v.HostName,
+				)
+				ch <- prometheus.MustNewConstMetric(
+					hostLatencySeconds, prometheus.GaugeValue, v.Latency, v.HostName,
+				)
+			}
+		}
+
 		if v.CheckType == 0 {
 			hostsActiveCheckCount++
 		} else {
@@ -418,33 +1057,36 @@ func (e *Exporter) HitNagiosRestApisAndUpdateMetrics(ch chan<- prometheus.Metric
 		hostsDowntime, prometheus.GaugeValue, float64(hostsDowntimeCount),
 	)
 
-	req, err = http.NewRequest("GET", e.nagiosEndpoint+servicestatusAPI+"?apikey="+e.nagiosAPIKey, nil)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "error: %v\n", err)
-		os.Exit(1)
+	if e.hostsDetailed {
+		if hostDetailedSeriesDropped > 0 {
+			logger.WithFields(logrus.Fields{"collector": "hoststatus", "dropped": hostDetailedSeriesDropped, "limit": e.detailedCardinalityLimit}).Warn("dropped host series after hitting the detailed cardinality limit")
+		}
+		ch <- prometheus.MustNewConstMetric(
+			detailedSeriesDropped, prometheus.CounterValue, float64(hostDetailedSeriesDropped), "hosts",
+		)
 	}
+}
 
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("User-Agent", "Prometheus")
-	resp, err = http.DefaultClient.Do(req)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "error: %v\n", err)
-		os.Exit(1)
-	}
-	if resp.Body != nil {
-		defer resp.Body.Close()
-	}
+// collectServiceStatus hits the servicestatus endpoint and emits service metrics.
+func (e *Exporter) collectServiceStatus(ctx context.Context, ch chan<- prometheus.Metric, wg *sync.WaitGroup) {
+	defer wg.Done()
 
-	body, readErr = ioutil.ReadAll(resp.Body)
-	if readErr != nil {
-		log.Fatal(readErr)
+	start := time.Now()
+	success := true
+	defer func() { reportCollectorResult(ch, "servicestatus", start, success) }()
+
+	body, err := e.fetchJSON(ctx, servicestatusAPI, "servicestatus")
+	if err != nil {
+		logger.WithField("collector", "servicestatus").WithError(err).Error("fetch failed")
+		success = false
+		return
 	}
 
 	serviceStatusObject := serviceStatus{}
-
-	jsonErr = json.Unmarshal(body, &serviceStatusObject)
-	if jsonErr != nil {
-		log.Fatal(jsonErr)
+	if jsonErr := json.Unmarshal(body, &serviceStatusObject); jsonErr != nil {
+		logger.WithField("collector", "servicestatus").WithError(jsonErr).Error("failed to unmarshal response")
+		success = false
+		return
 	}
 
 	ch <- prometheus.MustNewConstMetric(
@@ -452,11 +1094,41 @@ func (e *Exporter) HitNagiosRestApisAndUpdateMetrics(ch chan<- prometheus.Metric
 	)
 
 	var servicesCount, servicessCheckedCount, servicesScheduledCount, servicesActiveCheckCount, servicesPassiveCheckCount, servicesOkCount, servicesWarnCount, servicesCriticalCount, servicesUnknownCount, servicesFlapCount, servicesDowntimeCount int
+	var serviceDetailedSeriesEmitted, serviceDetailedSeriesDropped int
+	_, serviceGroupFilter := e.groupFilters()
+
+	var serviceGroupMembers map[string]bool
+	if e.servicesDetailed && serviceGroupFilter != nil {
+		var groupErr error
+		serviceGroupMembers, groupErr = e.fetchServiceGroupMembers(ctx, serviceGroupFilter)
+		if groupErr != nil {
+			logger.WithField("collector", "servicestatus").WithError(groupErr).Error("failed to resolve service group membership; dropping detailed metrics for this scrape")
+			serviceGroupMembers = map[string]bool{}
+		}
+	}
 
 	for _, v := range serviceStatusObject.Servicestatus {
 
 		servicesCount++
 
+		if e.servicesDetailed && (serviceGroupFilter == nil || serviceGroupMembers[v.HostName+"/"+v.ServiceDescription]) {
+			// each service contributes three series (state, last check, latency)
+			if serviceDetailedSeriesEmitted+3 > e.detailedCardinalityLimit {
+				serviceDetailedSeriesDropped += 3
+			} else {
+				serviceDetailedSeriesEmitted += 3
+				ch <- prometheus.MustNewConstMetric(
+					serviceState, prometheus.GaugeValue, v.CurrentState, v.HostName, v.ServiceDescription,
+				)
+				ch <- prometheus.MustNewConstMetric(
+					serviceLastCheckSeconds, prometheus.GaugeValue, v.LastCheck, v.HostName, v.ServiceDescription,
+				)
+				ch <- prometheus.MustNewConstMetric(
+					serviceLatencySeconds, prometheus.GaugeValue, v.Latency, v.HostName, v.ServiceDescription,
+				)
+			}
+		}
+
 		if v.HasBeenChecked == 0 {
 			servicessCheckedCount++
 		}
@@ -499,7 +1171,7 @@ func (e *Exporter) HitNagiosRestApisAndUpdateMetrics(ch chan<- prometheus.Metric
 	)
 
 	ch <- prometheus.MustNewConstMetric(
-		servicesPassivelyCheckedTotal, prometheus.GaugeValue, float64(hostsPassiveCheckCount),
+		servicesPassivelyCheckedTotal, prometheus.GaugeValue, float64(servicesPassiveCheckCount),
 	)
 
 	ch <- prometheus.MustNewConstMetric(
@@ -511,7 +1183,7 @@ func (e *Exporter) HitNagiosRestApisAndUpdateMetrics(ch chan<- prometheus.Metric
 	)
 
 	ch <- prometheus.MustNewConstMetric(
-		servicesCritical, prometheus.GaugeValue, float64(servicesWarnCount),
+		servicesCritical, prometheus.GaugeValue, float64(servicesCriticalCount),
 	)
 
 	ch <- prometheus.MustNewConstMetric(
@@ -526,8 +1198,237 @@ func (e *Exporter) HitNagiosRestApisAndUpdateMetrics(ch chan<- prometheus.Metric
 		servicesDowntime, prometheus.GaugeValue, float64(servicesDowntimeCount),
 	)
 
-	// TODO - better logging
-	log.Println("Endpoint scraped")
+	if e.servicesDetailed {
+		if serviceDetailedSeriesDropped > 0 {
+			logger.WithFields(logrus.Fields{"collector": "servicestatus", "dropped": serviceDetailedSeriesDropped, "limit": e.detailedCardinalityLimit}).Warn("dropped service series after hitting the detailed cardinality limit")
+		}
+		ch <- prometheus.MustNewConstMetric(
+			detailedSeriesDropped, prometheus.CounterValue, float64(serviceDetailedSeriesDropped), "services",
+		)
+	}
+}
+
+// alertSeverity maps a host/service current_state to the severity label
+// used on nagios_alerts_firing ("ok" covers both up/ok states).
+func alertSeverity(state float64) string {
+	switch state {
+	case 0:
+		return "ok"
+	case 1:
+		return "warning"
+	case 2:
+		return "critical"
+	default:
+		return "unknown"
+	}
+}
+
+// collectAlerts hits the alertlog endpoint, windowed to entries since the
+// last successful scrape, and emits alert metrics. Unlike the detailed
+// host/service metrics, this collector is always on, since alerting
+// activity (rather than current object state) is what it reports. Without
+// the window, the alertlog endpoint returns an instance's entire history,
+// which would make these metrics grow monotonically and never reflect
+// recent activity.
+func (e *Exporter) collectAlerts(ctx context.Context, ch chan<- prometheus.Metric, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	start := time.Now()
+	success := true
+	defer func() { reportCollectorResult(ch, "alerts", start, success) }()
+
+	windowStart := start.Add(-defaultAlertWindow)
+	if prevUnix := atomic.LoadInt64(&e.lastAlertsScrapeUnix); prevUnix != 0 {
+		windowStart = time.Unix(prevUnix, 0)
+	}
+	apiPath := fmt.Sprintf("%s?starttime=%d&endtime=%d", alertlogAPI, windowStart.Unix(), start.Unix())
+
+	body, err := e.fetchJSON(ctx, apiPath, "alerts")
+	if err != nil {
+		logger.WithField("collector", "alerts").WithError(err).Error("fetch failed")
+		success = false
+		return
+	}
+
+	alertLogObject := alertLog{}
+	if jsonErr := json.Unmarshal(body, &alertLogObject); jsonErr != nil {
+		logger.WithField("collector", "alerts").WithError(jsonErr).Error("failed to unmarshal response")
+		success = false
+		return
+	}
+
+	atomic.StoreInt64(&e.lastAlertsScrapeUnix, start.Unix())
+
+	ch <- prometheus.MustNewConstMetric(
+		alertsTotal, prometheus.GaugeValue, float64(alertLogObject.Recordcount),
+	)
+
+	type alertKey struct{ severity, host, service string }
+	firing := make(map[alertKey]int)
+	for _, a := range alertLogObject.Alertlog {
+		if a.State == 0 {
+			// not actually firing, just a log entry for a recovery
+			continue
+		}
+		firing[alertKey{alertSeverity(a.State), a.HostName, a.ServiceDescription}]++
+	}
+
+	var alertSeriesEmitted, alertSeriesDropped int
+	for k, count := range firing {
+		if alertSeriesEmitted >= e.detailedCardinalityLimit {
+			alertSeriesDropped++
+			continue
+		}
+		alertSeriesEmitted++
+		ch <- prometheus.MustNewConstMetric(
+			alertsFiring, prometheus.GaugeValue, float64(count), k.severity, k.host, k.service,
+		)
+	}
+
+	if alertSeriesDropped > 0 {
+		logger.WithFields(logrus.Fields{"collector": "alerts", "dropped": alertSeriesDropped, "limit": e.detailedCardinalityLimit}).Warn("dropped alert series after hitting the detailed cardinality limit")
+		ch <- prometheus.MustNewConstMetric(
+			detailedSeriesDropped, prometheus.CounterValue, float64(alertSeriesDropped), "alerts",
+		)
+	}
+}
+
+// reloadConfig re-reads the config at configPath and, on success, swaps the
+// new API key/filters/scrape-timeout/retries into exporter and holder (see
+// Exporter.updateConfig for what does and doesn't reload). It's shared by
+// the fsnotify watcher and the /-/reload handler.
+func reloadConfig(configPath string, exporter *Exporter, holder *configHolder) error {
+	conf, err := loadConfig(configPath)
+	if err != nil {
+		return err
+	}
+
+	exporter.updateConfig(conf)
+	holder.set(conf)
+	return nil
+}
+
+// watchConfig watches configPath for changes and reloads exporter whenever
+// it's written, logging the outcome and recording it via
+// nagios_exporter_config_reloads_total. It runs until the watcher itself
+// fails to initialize; fsnotify watches the containing directory rather
+// than the file directly, since editors commonly replace config files
+// instead of writing them in place.
+func watchConfig(configPath string, exporter *Exporter, holder *configHolder) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		logger.WithError(err).Error("failed to create config watcher")
+		return
+	}
+	defer watcher.Close()
+
+	if err := watcher.Add(filepath.Dir(configPath)); err != nil {
+		logger.WithError(err).Error("failed to watch config directory")
+		return
+	}
+
+	for {
+		select {
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+			if filepath.Clean(event.Name) != filepath.Clean(configPath) {
+				continue
+			}
+			if event.Op&(fsnotify.Write|fsnotify.Create) == 0 {
+				continue
+			}
+
+			if err := reloadConfig(configPath, exporter, holder); err != nil {
+				configReloadsTotal.WithLabelValues("failure").Inc()
+				logger.WithError(err).Error("config reload failed")
+				continue
+			}
+			configReloadsTotal.WithLabelValues("success").Inc()
+			logger.Info("config reloaded successfully")
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+			logger.WithError(err).Error("config watcher error")
+		}
+	}
+}
+
+// probeHandler implements a blackbox_exporter-style /probe endpoint: it
+// builds a throwaway Exporter for ?target=, scoped to the settings of
+// ?module= (which defaults to "default"; with no "default" entry the
+// top-level config is used, while any other unknown module is rejected
+// with 400), collects it into a fresh registry, and serves only that scrape's
+// metrics. This lets one exporter process be pointed at a fleet of NagiosXI
+// instances via Prometheus file_sd/relabeling instead of one process per
+// target.
+func probeHandler(w http.ResponseWriter, r *http.Request, holder *configHolder) {
+	target := r.URL.Query().Get("target")
+	if target == "" {
+		http.Error(w, "target parameter is required", http.StatusBadRequest)
+		return
+	}
+	targetURL, err := url.Parse(target)
+	if err != nil || (targetURL.Scheme != "http" && targetURL.Scheme != "https") {
+		http.Error(w, "target must be a URL with an http:// or https:// scheme", http.StatusBadRequest)
+		return
+	}
+
+	moduleName := r.URL.Query().Get("module")
+	if moduleName == "" {
+		moduleName = "default"
+	}
+
+	conf := holder.get()
+	module, ok := conf.Modules[moduleName]
+	if !ok && moduleName != "default" {
+		http.Error(w, fmt.Sprintf("unknown module %q", moduleName), http.StatusBadRequest)
+		return
+	}
+
+	apiKey := module.APIKey
+	if apiKey == "" {
+		apiKey = conf.APIKey
+	}
+	hostGroupFilter := module.HostGroupFilter
+	if hostGroupFilter == nil {
+		hostGroupFilter = conf.HostGroupFilter
+	}
+	serviceGroupFilter := module.ServiceGroupFilter
+	if serviceGroupFilter == nil {
+		serviceGroupFilter = conf.ServiceGroupFilter
+	}
+
+	tlsConfig, err := holder.moduleTLSConfig(moduleName, module)
+	if err != nil {
+		logger.WithError(err).WithField("target", target).Error("probe: failed to build TLS config")
+		http.Error(w, fmt.Sprintf("failed to build TLS config: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	httpTimeout := defaultScrapeTimeout
+	if module.HTTPTimeoutSeconds > 0 {
+		httpTimeout = time.Duration(module.HTTPTimeoutSeconds) * time.Second
+	}
+
+	probeExporter := NewExporter(targetURL.String()+nagiosAPIVersion+apiSlug, apiKey)
+	probeExporter.scrapeTimeout = httpTimeout
+	probeExporter.httpRetries = module.HTTPRetries
+	probeExporter.httpClient = &http.Client{
+		Timeout:   httpTimeout,
+		Transport: &http.Transport{TLSClientConfig: tlsConfig},
+	}
+	probeExporter.updateConfig(Config{
+		APIKey:             apiKey,
+		HostGroupFilter:    hostGroupFilter,
+		ServiceGroupFilter: serviceGroupFilter,
+	})
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(probeExporter)
+	promhttp.HandlerFor(registry, promhttp.HandlerOpts{}).ServeHTTP(w, r)
 }
 
 func main() {
@@ -541,22 +1442,94 @@ func main() {
 			"Nagios application address")
 		configPath = flag.String("config.path", "/etc/nagios_exporter/config.toml",
 			"Config file path")
+		hostsDetailed = flag.Bool("collector.hosts.detailed", false,
+			"Enable per-host labeled metrics (nagios_host_state, nagios_host_last_check_seconds, nagios_host_latency_seconds)")
+		servicesDetailed = flag.Bool("collector.services.detailed", false,
+			"Enable per-service labeled metrics (nagios_service_state, nagios_service_last_check_seconds, nagios_service_latency_seconds)")
+		detailedCardinalityLimit = flag.Int("collector.detailed.cardinality-limit", defaultDetailedCardinalityLimit,
+			"Maximum number of per-host/per-service series to emit per scrape before dropping the overflow")
+		scrapeTimeout = flag.Duration("collector.scrape-timeout", defaultScrapeTimeout,
+			"Timeout for the systeminfo/hoststatus/servicestatus/alerts sub-collectors")
+		logLevel = flag.String("log.level", "info",
+			"Only log messages with the given severity or above (debug, info, warn, error)")
+		logFormat = flag.String("log.format", "logfmt",
+			"Output format of log messages (logfmt, json)")
+		useHTTPS = flag.Bool("nagios.use-https", false,
+			"Connect to the Nagios application over HTTPS")
+		tlsCAFile = flag.String("nagios.tls.ca-file", "",
+			"Optional CA bundle used to verify the Nagios application's TLS certificate")
+		tlsCertFile = flag.String("nagios.tls.cert-file", "",
+			"Optional client certificate for TLS connections to the Nagios application")
+		tlsKeyFile = flag.String("nagios.tls.key-file", "",
+			"Optional client key for TLS connections to the Nagios application")
+		tlsInsecureSkipVerify = flag.Bool("nagios.tls.insecure-skip-verify", false,
+			"Disable TLS certificate verification for the Nagios application (insecure)")
+		httpTimeout = flag.Duration("nagios.http-timeout", defaultScrapeTimeout,
+			"Timeout for individual HTTP requests to the Nagios application")
+		httpRetries = flag.Int("nagios.http-retries", 2,
+			"Number of retries for transient 5xx/network errors when querying the Nagios application")
+		webBasicAuthUsername = flag.String("web.basic-auth.username", "",
+			"Username required to access the telemetry path (leave unset to disable basic auth)")
+		webBasicAuthPassword = flag.String("web.basic-auth.password", "",
+			"Password required to access the telemetry path (leave unset to disable basic auth)")
 	)
 
 	flag.Parse()
 
+	level, err := logrus.ParseLevel(*logLevel)
+	if err != nil {
+		logger.WithError(err).Fatal("invalid --log.level")
+	}
+	logger.SetLevel(level)
+	switch *logFormat {
+	case "json":
+		logger.SetFormatter(&logrus.JSONFormatter{})
+	case "logfmt":
+		logger.SetFormatter(&logrus.TextFormatter{DisableColors: true, FullTimestamp: true})
+	default:
+		logger.Fatalf("invalid --log.format: %q (want logfmt or json)", *logFormat)
+	}
+
 	var conf Config = ReadConfig(*configPath)
 
-	// TODO - HTTPS?
-	nagiosURL := "http://" + *remoteAddress + nagiosAPIVersion + apiSlug
-	// nagiosURL := "http://" + *remoteAddress + "/nagiosxi/api/v1/objects/servicestatus?apikey=" + conf.APIKey
+	scheme := "http://"
+	if *useHTTPS {
+		scheme = "https://"
+	}
+	nagiosURL := scheme + *remoteAddress + nagiosAPIVersion + apiSlug
+
+	tlsConfig, err := buildTLSConfig(*tlsCAFile, *tlsCertFile, *tlsKeyFile, *tlsInsecureSkipVerify)
+	if err != nil {
+		logger.WithError(err).Fatal("failed to build TLS config")
+	}
 
 	exporter := NewExporter(nagiosURL, conf.APIKey)
+	exporter.hostsDetailed = *hostsDetailed
+	exporter.servicesDetailed = *servicesDetailed
+	exporter.detailedCardinalityLimit = *detailedCardinalityLimit
+	exporter.scrapeTimeout = *scrapeTimeout
+	exporter.httpRetries = *httpRetries
+	exporter.httpClient = &http.Client{
+		Timeout:   *httpTimeout,
+		Transport: &http.Transport{TLSClientConfig: tlsConfig},
+	}
+	exporter.updateConfig(conf)
 	prometheus.MustRegister(exporter)
-	// todo - use better logging system
-	log.Printf("Using connection endpoint: %s", *remoteAddress)
+	prometheus.MustRegister(configReloadsTotal)
+	logger.WithField("endpoint", *remoteAddress).Info("using connection endpoint")
+
+	confHolder := &configHolder{conf: conf}
+	go watchConfig(*configPath, exporter, confHolder)
 
-	http.Handle(*metricsPath, promhttp.Handler())
+	if (*webBasicAuthUsername == "") != (*webBasicAuthPassword == "") {
+		logger.Fatal("--web.basic-auth.username and --web.basic-auth.password must both be set to enable basic auth")
+	}
+
+	var metricsHandler http.Handler = promhttp.Handler()
+	if *webBasicAuthUsername != "" && *webBasicAuthPassword != "" {
+		metricsHandler = basicAuthMiddleware(metricsHandler, *webBasicAuthUsername, *webBasicAuthPassword)
+	}
+	http.Handle(*metricsPath, metricsHandler)
 	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		w.Write([]byte(`<html>
 			<head><title>Nagios Exporter</title></head>
@@ -566,7 +1539,27 @@ func main() {
 			</body>
 			</html>`))
 	})
+	http.HandleFunc("/-/reload", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		if err := reloadConfig(*configPath, exporter, confHolder); err != nil {
+			configReloadsTotal.WithLabelValues("failure").Inc()
+			logger.WithError(err).Error("manual config reload failed")
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprintf(w, "error: %v\n", err)
+			return
+		}
+		configReloadsTotal.WithLabelValues("success").Inc()
+		logger.Info("config reloaded successfully")
+		w.WriteHeader(http.StatusOK)
+	})
+	http.HandleFunc("/probe", func(w http.ResponseWriter, r *http.Request) {
+		probeHandler(w, r, confHolder)
+	})
 
-	log.Fatal(http.ListenAndServe(*listenAddress, nil))
+	logger.Fatal(http.ListenAndServe(*listenAddress, nil))
 
 }